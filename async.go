@@ -0,0 +1,520 @@
+package logrus_fluent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+)
+
+// OnFullPolicy controls what happens when an async hook's buffer is full.
+type OnFullPolicy int
+
+const (
+	// Block makes Fire wait until room is available in the buffer.
+	Block OnFullPolicy = iota
+	// DropOldest discards the oldest buffered message to make room.
+	DropOldest
+	// DropNewest discards the message that was about to be enqueued.
+	DropNewest
+)
+
+// AsyncConfig configures asynchronous, buffered delivery for a FluentHook.
+// See EnableAsync.
+type AsyncConfig struct {
+	// BufferSize is the number of messages the queue can hold before
+	// OnFull kicks in. Defaults to 1000 if zero.
+	BufferSize int
+	// Workers is the number of goroutines draining the queue. Defaults
+	// to 1 if zero.
+	Workers int
+	// OnFull selects the back-pressure policy once the queue is full.
+	OnFull OnFullPolicy
+	// MaxRetries is how many times delivery of a single message is
+	// retried before it's spooled (if SpoolDir is set) or dropped.
+	MaxRetries int
+	// RetryBackoff is the delay between delivery retries.
+	RetryBackoff time.Duration
+	// ReconnectInterval is the minimum delay between reconnect attempts
+	// after a connection failure.
+	ReconnectInterval time.Duration
+	// SpoolDir, when non-empty, is a directory where messages that
+	// exhausted MaxRetries are appended as rotated, newline-delimited
+	// JSON files, to be replayed once the connection recovers.
+	SpoolDir string
+}
+
+// AsyncStats is a snapshot of an async hook's delivery counters.
+type AsyncStats struct {
+	Enqueued uint64
+	Sent     uint64
+	Dropped  uint64
+	Retried  uint64
+	Spooled  uint64
+}
+
+const (
+	defaultBufferSize  = 1000
+	defaultWorkerCount = 1
+	spoolMaxBytes      = 10 << 20 // 10MiB per spool file before rotation
+)
+
+var errNotConnected = errors.New("logrus_fluent: not connected yet")
+
+type fluentMessage struct {
+	tag  string
+	time time.Time
+	data interface{}
+}
+
+// asyncDispatcher owns the buffered queue, worker pool, connection and
+// (optional) disk spool backing a FluentHook once EnableAsync is called.
+type asyncDispatcher struct {
+	cfg     AsyncConfig
+	fluentC Config
+
+	queue chan fluentMessage
+	wg    sync.WaitGroup
+
+	// closeMu guards closed and serializes it against concurrent sends on
+	// queue: enqueue holds a read lock for the duration of its send, and
+	// Close takes the write lock before closing queue, so queue is never
+	// closed while a send on it is still in flight.
+	closeMu sync.RWMutex
+	closed  bool
+
+	enqueueMu sync.Mutex
+
+	// replaying is a single-flight guard around replaySpool: with
+	// Workers > 1, two workers can both succeed a post around the same
+	// time and both try to replay the same spooled files, redelivering
+	// every record once per concurrent replayer. Only one replay runs at
+	// a time; a worker that loses the race just skips its replay, since
+	// the winner will have drained everything replayable anyway.
+	replaying int32
+
+	connMu             sync.Mutex
+	conn               *fluent.Fluent
+	sharedConn         *fluent.Fluent // hook.Fluent, if the hook has a persistent logger
+	lastConnectAttempt time.Time
+
+	spool *spool
+
+	stats AsyncStats
+}
+
+// EnableAsync switches the hook to asynchronous, buffered delivery: Fire
+// enqueues messages instead of calling PostWithTime inline, and a pool of
+// background workers drains the queue, retrying and reconnecting as
+// needed. Call Close to drain the queue before the process exits.
+func (hook *FluentHook) EnableAsync(cfg AsyncConfig) error {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkerCount
+	}
+
+	d := &asyncDispatcher{
+		cfg:        cfg,
+		fluentC:    hook.cfg,
+		queue:      make(chan fluentMessage, cfg.BufferSize),
+		sharedConn: hook.Fluent,
+	}
+
+	if cfg.SpoolDir != "" {
+		s, err := newSpool(cfg.SpoolDir)
+		if err != nil {
+			return fmt.Errorf("logrus_fluent: spool dir: %w", err)
+		}
+		d.spool = s
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+
+	hook.dispatcher = d
+	return nil
+}
+
+// Stats returns a snapshot of the async hook's delivery counters. It
+// returns a zero-value AsyncStats if async delivery isn't enabled.
+func (hook *FluentHook) Stats() AsyncStats {
+	if hook.dispatcher == nil {
+		return AsyncStats{}
+	}
+	return hook.dispatcher.snapshot()
+}
+
+// Close drains the async queue and stops its workers, waiting up to
+// ctx's deadline. It is a no-op if async delivery isn't enabled.
+func (hook *FluentHook) Close(ctx context.Context) error {
+	if hook.dispatcher == nil {
+		return nil
+	}
+
+	d := hook.dispatcher
+	d.closeMu.Lock()
+	d.closed = true
+	close(d.queue)
+	d.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *asyncDispatcher) snapshot() AsyncStats {
+	return AsyncStats{
+		Enqueued: atomic.LoadUint64(&d.stats.Enqueued),
+		Sent:     atomic.LoadUint64(&d.stats.Sent),
+		Dropped:  atomic.LoadUint64(&d.stats.Dropped),
+		Retried:  atomic.LoadUint64(&d.stats.Retried),
+		Spooled:  atomic.LoadUint64(&d.stats.Spooled),
+	}
+}
+
+// enqueue posts msg to the queue, applying cfg.OnFull's back-pressure
+// policy. It holds closeMu for the duration of the send so Close can't
+// close queue out from under it; once Close has flipped closed, enqueue
+// drops the message instead of sending on a queue that may already be
+// closed.
+func (d *asyncDispatcher) enqueue(msg fluentMessage) {
+	d.closeMu.RLock()
+	defer d.closeMu.RUnlock()
+
+	if d.closed {
+		atomic.AddUint64(&d.stats.Dropped, 1)
+		return
+	}
+
+	atomic.AddUint64(&d.stats.Enqueued, 1)
+
+	switch d.cfg.OnFull {
+	case DropNewest:
+		select {
+		case d.queue <- msg:
+		default:
+			atomic.AddUint64(&d.stats.Dropped, 1)
+		}
+	case DropOldest:
+		d.enqueueMu.Lock()
+		defer d.enqueueMu.Unlock()
+		for {
+			select {
+			case d.queue <- msg:
+				return
+			default:
+			}
+			select {
+			case <-d.queue:
+				atomic.AddUint64(&d.stats.Dropped, 1)
+			default:
+			}
+		}
+	default: // Block
+		d.queue <- msg
+	}
+}
+
+func (d *asyncDispatcher) worker() {
+	defer d.wg.Done()
+	for msg := range d.queue {
+		d.send(msg)
+	}
+}
+
+func (d *asyncDispatcher) send(msg fluentMessage) {
+	maxRetries := d.cfg.MaxRetries
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			atomic.AddUint64(&d.stats.Retried, 1)
+			time.Sleep(d.cfg.RetryBackoff)
+		}
+
+		err = d.post(msg)
+		if err == nil {
+			atomic.AddUint64(&d.stats.Sent, 1)
+			d.replaySpool()
+			return
+		}
+	}
+
+	if d.spool != nil {
+		if spoolErr := d.spool.Append(msg); spoolErr == nil {
+			atomic.AddUint64(&d.stats.Spooled, 1)
+			return
+		}
+	}
+
+	atomic.AddUint64(&d.stats.Dropped, 1)
+}
+
+func (d *asyncDispatcher) post(msg fluentMessage) error {
+	conn, err := d.connect()
+	if err != nil {
+		return err
+	}
+
+	err = conn.PostWithTime(msg.tag, msg.time, msg.data)
+	if err != nil && d.sharedConn == nil {
+		d.connMu.Lock()
+		d.conn = nil
+		d.connMu.Unlock()
+	}
+	return err
+}
+
+// connect returns the connection to post through, reusing the hook's
+// persistent logger if it has one, and otherwise lazily dialing (and
+// redialing, throttled by ReconnectInterval) its own.
+func (d *asyncDispatcher) connect() (*fluent.Fluent, error) {
+	if d.sharedConn != nil {
+		return d.sharedConn, nil
+	}
+
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+
+	if d.conn != nil {
+		return d.conn, nil
+	}
+	if time.Since(d.lastConnectAttempt) < d.cfg.ReconnectInterval {
+		return nil, errNotConnected
+	}
+	d.lastConnectAttempt = time.Now()
+
+	fc, err := d.fluentC.fluentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := fluent.New(fc)
+	if err != nil {
+		return nil, err
+	}
+
+	d.conn = conn
+	return conn, nil
+}
+
+// replaySpool attempts to flush any spooled messages now that a post has
+// just succeeded, implying the connection is healthy again. It's a no-op
+// if a replay is already in flight on another worker, since spool.Replay
+// itself has no protection against two callers listing and draining the
+// same files concurrently.
+func (d *asyncDispatcher) replaySpool() {
+	if d.spool == nil {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&d.replaying, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&d.replaying, 0)
+
+	conn, err := d.connect()
+	if err != nil {
+		return
+	}
+
+	sent := d.spool.Replay(func(rec spoolRecord) error {
+		return conn.PostWithTime(rec.Tag, rec.Time, rec.Data)
+	})
+	if sent > 0 {
+		atomic.AddUint64(&d.stats.Sent, uint64(sent))
+	}
+}
+
+// spoolRecord is the on-disk representation of a spooled message.
+type spoolRecord struct {
+	Tag  string      `json:"tag"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// spool is an append-only, size-rotated, on-disk queue used to hold
+// messages that couldn't be delivered after MaxRetries, so they can be
+// replayed once the fluentd connection recovers.
+type spool struct {
+	dir string
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &spool{dir: dir}, nil
+}
+
+func (s *spool) Append(msg fluentMessage) error {
+	line, err := json.Marshal(spoolRecord{Tag: msg.tag, Time: msg.time, Data: msg.data})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.size+int64(len(line)) > spoolMaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *spool) rotate() error {
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	name := filepath.Join(s.dir, fmt.Sprintf("spool-%d.jsonl", time.Now().UnixNano()))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.file = f
+	s.size = 0
+	return nil
+}
+
+// Replay reads spooled files in creation order and hands each record to
+// post. A file is deleted once every record in it has been posted
+// successfully; the first failure stops the whole replay: the unsent
+// tail of that file is written back to a new spool file, and later files
+// are left untouched for the next attempt. It returns the number of
+// records successfully replayed.
+func (s *spool) Replay(post func(spoolRecord) error) int {
+	s.mu.Lock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	s.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return 0
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	sent := 0
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		n, ok := s.replayFile(path, post)
+		sent += n
+		if !ok {
+			break
+		}
+	}
+	return sent
+}
+
+// replayFile replays every record in path, returning the count replayed
+// and whether the whole file was replayed (false means the file could not
+// be read, or a record failed and the remaining tail was written back for
+// a future attempt).
+func (s *spool) replayFile(path string, post func(spoolRecord) error) (int, bool) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	lines := splitLines(raw)
+	sent := 0
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec spoolRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue // drop unparsable records rather than blocking replay forever
+		}
+
+		if err := post(rec); err != nil {
+			s.writeRemainder(path, lines[i:])
+			return sent, false
+		}
+		sent++
+	}
+
+	os.Remove(path)
+	return sent, true
+}
+
+func (s *spool) writeRemainder(path string, remaining [][]byte) {
+	os.Remove(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, line := range remaining {
+		if len(line) == 0 {
+			continue
+		}
+		line = append(line, '\n')
+		if s.file == nil || s.size+int64(len(line)) > spoolMaxBytes {
+			if err := s.rotate(); err != nil {
+				return
+			}
+		}
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func splitLines(raw []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i, b := range raw {
+		if b == '\n' {
+			lines = append(lines, raw[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(raw) {
+		lines = append(lines, raw[start:])
+	}
+	return lines
+}
@@ -0,0 +1,55 @@
+package logrus_fluent
+
+import "testing"
+
+func TestConfigFluentConfigTLSAndMessagePack(t *testing.T) {
+	cfg := Config{
+		Host:                 "fluentd.internal",
+		Port:                 24224,
+		TLS:                  true,
+		InsecureSkipVerify:   true,
+		MarshalAsMessagePack: true,
+	}
+
+	fc, err := cfg.fluentConfig()
+	if err != nil {
+		t.Fatalf("fluentConfig returned error: %v", err)
+	}
+
+	if fc.FluentNetwork != "tls" {
+		t.Fatalf(`FluentNetwork = %q, want "tls"`, fc.FluentNetwork)
+	}
+	if !fc.TlsInsecureSkipVerify {
+		t.Fatalf("expected TlsInsecureSkipVerify = true")
+	}
+	if fc.MarshalAsJSON {
+		t.Fatalf("expected MarshalAsJSON = false when MarshalAsMessagePack is set")
+	}
+	if fc.FluentHost != cfg.Host || fc.FluentPort != cfg.Port {
+		t.Fatalf("FluentHost/FluentPort = %q/%d, want %q/%d", fc.FluentHost, fc.FluentPort, cfg.Host, cfg.Port)
+	}
+}
+
+func TestConfigFluentConfigDefaultNetworkIsPlaintext(t *testing.T) {
+	cfg := Config{Host: "fluentd.internal", Port: 24224}
+
+	fc, err := cfg.fluentConfig()
+	if err != nil {
+		t.Fatalf("fluentConfig returned error: %v", err)
+	}
+
+	if fc.FluentNetwork != "" {
+		t.Fatalf(`FluentNetwork = %q, want "" (library default) when TLS is unset`, fc.FluentNetwork)
+	}
+	if !fc.MarshalAsJSON {
+		t.Fatalf("expected MarshalAsJSON = true by default")
+	}
+}
+
+func TestConfigFluentConfigRejectsSharedKeyAuth(t *testing.T) {
+	cfg := Config{Host: "fluentd.internal", Port: 24224, SharedKey: "secret"}
+
+	if _, err := cfg.fluentConfig(); err == nil {
+		t.Fatalf("expected an error for an unsupported SharedKey config")
+	}
+}
@@ -0,0 +1,107 @@
+package logrus_fluent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ConvertToValue converts v into the plain map[string]interface{} /
+// []interface{} / scalar shape that fluent.Fluent.PostWithTime expects,
+// so callers can log arbitrary structs (not just logrus.Fields) through
+// Fire. Struct fields are named and filtered per their tagName struct
+// tag, using the same syntax documented on TagName: a bare name renames
+// the field, "-" always omits it, and ",omitempty" omits it when it
+// holds its zero value. This is also the shape FluentHook.redact
+// recurses through.
+func ConvertToValue(v interface{}, tagName string) interface{} {
+	return convertValue(reflect.ValueOf(v), tagName)
+}
+
+func convertValue(rv reflect.Value, tagName string) interface{} {
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return convertValue(rv.Elem(), tagName)
+	case reflect.Struct:
+		return convertStruct(rv, tagName)
+	case reflect.Map:
+		out := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			out[fmt.Sprint(key.Interface())] = convertValue(rv.MapIndex(key), tagName)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out[i] = convertValue(rv.Index(i), tagName)
+		}
+		return out
+	default:
+		return rv.Interface()
+	}
+}
+
+func convertStruct(rv reflect.Value, tagName string) map[string]interface{} {
+	rt := rv.Type()
+	out := make(map[string]interface{}, rt.NumField())
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			// unexported field
+			continue
+		}
+
+		name := field.Name
+		omitempty := false
+		if tag, ok := field.Tag.Lookup(tagName); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					omitempty = true
+				}
+			}
+		}
+
+		fv := rv.Field(i)
+		if omitempty && isEmptyValue(fv) {
+			continue
+		}
+
+		out[name] = convertValue(fv, tagName)
+	}
+
+	return out
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
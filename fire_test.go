@@ -0,0 +1,96 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// TestFireDefaultPrefixTrimAndSend pins the baseline behavior every
+// pre-existing hook (HookOnlyPrefix unset) relies on: Prefix-carrying
+// fields are trimmed and sent, not dropped. a9d5b6d regressed this by
+// dropping them outright; eddf2a8 restored it with no test to catch a
+// repeat.
+func TestFireDefaultPrefixTrimAndSend(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+
+	var got map[string]interface{}
+	hook.postFunc = func(tag string, tm time.Time, data interface{}) error {
+		got = data.(map[string]interface{})
+		return nil
+	}
+
+	entry := &logrus.Entry{
+		Time:    time.Now(),
+		Message: "hi",
+		Data:    logrus.Fields{"_internal": "secret", "plain": "ok"},
+	}
+
+	if err := hook.Fire(entry); err != nil {
+		t.Fatalf("Fire returned error: %v", err)
+	}
+
+	if got["internal"] != "secret" {
+		t.Fatalf(`got["internal"] = %v, want "secret"`, got["internal"])
+	}
+	if got["plain"] != "ok" {
+		t.Fatalf(`got["plain"] = %v, want "ok"`, got["plain"])
+	}
+	if _, ok := entry.Data["_internal"]; ok {
+		t.Fatalf(`expected "_internal" removed from entry.Data after trim-and-send`)
+	}
+}
+
+// TestFireHookOnlyPrefixDoesNotStepOnOtherHooks covers two hooks with
+// distinct HookOnlyPrefix values firing on the same entry: each should
+// only see (and trim) its own prefix, leaving the other's field alone for
+// whichever hook owns it.
+func TestFireHookOnlyPrefixDoesNotStepOnOtherHooks(t *testing.T) {
+	appHook := NewHook("localhost", 24224)
+	appHook.SetHookOnlyPrefix("_app_")
+
+	dbHook := NewHook("localhost", 24224)
+	dbHook.SetHookOnlyPrefix("_db_")
+
+	var appGot, dbGot map[string]interface{}
+	appHook.postFunc = func(tag string, tm time.Time, data interface{}) error {
+		appGot = data.(map[string]interface{})
+		return nil
+	}
+	dbHook.postFunc = func(tag string, tm time.Time, data interface{}) error {
+		dbGot = data.(map[string]interface{})
+		return nil
+	}
+
+	entry := &logrus.Entry{
+		Time:    time.Now(),
+		Message: "hi",
+		Data: logrus.Fields{
+			"_app_name": "myapp",
+			"_db_table": "users",
+			"plain":     "ok",
+		},
+	}
+
+	if err := appHook.Fire(entry); err != nil {
+		t.Fatalf("appHook.Fire returned error: %v", err)
+	}
+	if err := dbHook.Fire(entry); err != nil {
+		t.Fatalf("dbHook.Fire returned error: %v", err)
+	}
+
+	if appGot["name"] != "myapp" {
+		t.Fatalf(`appGot["name"] = %v, want "myapp"`, appGot["name"])
+	}
+	if _, ok := appGot["table"]; ok {
+		t.Fatalf("appHook should not have received dbHook's field, got %#v", appGot)
+	}
+
+	if dbGot["table"] != "users" {
+		t.Fatalf(`dbGot["table"] = %v, want "users"`, dbGot["table"])
+	}
+	if _, ok := dbGot["name"]; ok {
+		t.Fatalf("dbHook should not have received appHook's field, got %#v", dbGot)
+	}
+}
@@ -2,6 +2,7 @@ package logrus_fluent
 
 import (
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/fluent/fluent-logger-golang/fluent"
@@ -24,10 +25,39 @@ const (
 	MessageField = "message"
 )
 
+// Prefix marks field keys that hooks route specially. A hook with no
+// HookOnlyPrefix sends such fields with Prefix trimmed and deletes them
+// from entry.Data, unless a field with the trimmed name already exists, in
+// which case the field is sent untrimmed and kept. A hook with a
+// HookOnlyPrefix sends only the ones
+// matching it and skips the rest, leaving them in entry.Data.
 var Prefix = "_"
 
+// AlwaysSentFields is a package-global set of fields merged into every
+// hook's entry.Data.
+//
+// Deprecated: use FluentHook.AddAlwaysSentField instead, which keeps
+// each hook's set independent so multiple hooks in one process don't
+// race on a shared map.
 var AlwaysSentFields logrus.Fields = make(logrus.Fields)
 
+// Schema selects the shape of the map passed to the fluentd logger.
+type Schema int
+
+const (
+	// SchemaFluentd is the default payload shape: plain fields plus the
+	// "app"/"level"/"message" conveniences already produced by Fire.
+	SchemaFluentd Schema = iota
+	// SchemaLogstash reshapes the payload to match the Logstash event
+	// schema (@version, @timestamp, type) expected by downstream ELK
+	// pipelines.
+	SchemaLogstash
+)
+
+// DefaultTimeFormat is the time format used for the Logstash "@timestamp"
+// field when no format has been set via SetTimeFormat.
+const DefaultTimeFormat = time.RFC3339Nano
+
 var defaultLevels = []logrus.Level{
 	logrus.PanicLevel,
 	logrus.FatalLevel,
@@ -41,17 +71,57 @@ type FluentHook struct {
 	// Fluent is actual fluentd logger.
 	// If set, this logger is used for logging.
 	// otherwise new logger is created every time.
-	Fluent     *fluent.Fluent
+	Fluent *fluent.Fluent
+
+	// PrefixOnly hooks only strip fields carrying the package-level
+	// Prefix from entry.Data, as a side effect, and never send anything
+	// themselves.
+	//
+	// Deprecated: configure HookOnlyPrefix on an ordinary hook instead;
+	// it strips the same fields but also forwards them to fluentd
+	// rather than discarding them.
 	PrefixOnly bool
 
-	host   string
-	port   int
+	// HookOnlyPrefix, when non-empty, restricts which Prefix-carrying
+	// fields this hook sends to those whose key has this prefix: they are
+	// stripped of the prefix, sent to fluentd, and deleted from entry.Data
+	// so hooks firing after this one never see them. Other Prefix-carrying
+	// fields are skipped; fields without Prefix are sent as usual. Hooks
+	// that leave HookOnlyPrefix unset behave as
+	// they always have: every Prefix-carrying field is trimmed and sent
+	// by them too.
+	HookOnlyPrefix string
+
 	levels []logrus.Level
 	tag    *string
 	app    string
 
-	ignoreFields map[string]struct{}
-	filters      map[string]func(interface{}) interface{}
+	// cfg is the Config this hook (and any asyncDispatcher it starts)
+	// was built from, kept around so every reconnect -- lazy per-Fire
+	// dials included -- honors the same TLS/timeout/encoding settings.
+	cfg Config
+
+	schema Schema
+	// timeFormat is nil until SetTimeFormat is called, so applySchema can
+	// tell "never configured" apart from "configured to DefaultTimeFormat".
+	timeFormat *string
+
+	privacy   bool
+	redactors map[string]Redactor
+
+	// dispatcher is non-nil once EnableAsync has been called; Fire then
+	// enqueues instead of posting inline.
+	dispatcher *asyncDispatcher
+
+	ignoreFields     map[string]struct{}
+	filters          map[string]func(interface{}) interface{}
+	alwaysSentFields logrus.Fields
+
+	// postFunc, when non-nil, replaces the real connect-and-PostWithTime
+	// step Fire would otherwise take for a non-async hook. It exists so
+	// tests can assert on the payload Fire computes without dialing
+	// fluentd.
+	postFunc func(tag string, t time.Time, data interface{}) error
 }
 
 // New returns initialized logrus hook for fluentd with persistent fluentd logger.
@@ -59,46 +129,40 @@ func New(host string, port int) (*FluentHook, error) {
 	return NewAppHook(host, port, "")
 }
 
-func NewPrefixHook() *FluentHook {
-	return &FluentHook{
-		levels:       defaultLevels,
-		PrefixOnly:   true,
-		tag:          nil,
-		ignoreFields: make(map[string]struct{}),
-		filters:      make(map[string]func(interface{}) interface{}),
-	}
-}
-
 // NewAppHook returns initialized logrus hook for fluentd with persistent fluentd logger and sets ther application name.
 func NewAppHook(host string, port int, app string) (*FluentHook, error) {
-	fd, err := fluent.New(fluent.Config{FluentHost: host, FluentPort: port, MarshalAsJSON: true})
-	if err != nil {
-		return nil, err
-	}
+	return NewWithConfig(Config{Host: host, Port: port, App: app})
+}
 
+// NewPrefixHook returns a hook that only strips Prefix-carrying fields
+// from entry.Data, without sending anything itself.
+//
+// Deprecated: set HookOnlyPrefix on a regular hook instead; it forwards
+// the stripped fields to fluentd rather than discarding them.
+func NewPrefixHook() *FluentHook {
 	return &FluentHook{
-		levels:       defaultLevels,
-		Fluent:       fd,
-		PrefixOnly:   false,
-		tag:          nil,
-		ignoreFields: make(map[string]struct{}),
-		filters:      make(map[string]func(interface{}) interface{}),
-		app:          app,
-	}, nil
+		levels:           defaultLevels,
+		PrefixOnly:       true,
+		tag:              nil,
+		ignoreFields:     make(map[string]struct{}),
+		filters:          make(map[string]func(interface{}) interface{}),
+		alwaysSentFields: make(logrus.Fields),
+		redactors:        make(map[string]Redactor),
+	}
 }
 
 // NewHook returns initialized logrus hook for fluentd.
 // (** deperecated: use New() **)
 func NewHook(host string, port int) *FluentHook {
 	return &FluentHook{
-		host:         host,
-		port:         port,
-		PrefixOnly:   false,
-		levels:       defaultLevels,
-		tag:          nil,
-		ignoreFields: make(map[string]struct{}),
-		filters:      make(map[string]func(interface{}) interface{}),
-		app:          "",
+		levels:           defaultLevels,
+		tag:              nil,
+		ignoreFields:     make(map[string]struct{}),
+		filters:          make(map[string]func(interface{}) interface{}),
+		alwaysSentFields: make(logrus.Fields),
+		redactors:        make(map[string]Redactor),
+		app:              "",
+		cfg:              Config{Host: host, Port: port},
 	}
 }
 
@@ -126,6 +190,46 @@ func (hook *FluentHook) SetTag(tag string) {
 	hook.tag = &tag
 }
 
+// SetSchema sets the payload schema used to shape the map handed to
+// logger.PostWithTime. Defaults to SchemaFluentd.
+func (hook *FluentHook) SetSchema(schema Schema) {
+	hook.schema = schema
+}
+
+// SetTimeFormat sets the time format used for the timestamp field: "time"
+// under SchemaFluentd, "@timestamp" under SchemaLogstash. It is honored
+// regardless of the configured schema, so it can be set independently of
+// SetSchema. Under SchemaLogstash, leaving it unset uses DefaultTimeFormat;
+// under SchemaFluentd, leaving it unset omits the timestamp field entirely, matching pre-existing
+// behavior for callers that never call SetTimeFormat.
+func (hook *FluentHook) SetTimeFormat(format string) {
+	hook.timeFormat = &format
+}
+
+// effectiveTimeFormat returns the time format to use once a timestamp field
+// is known to be wanted: hook.timeFormat if SetTimeFormat was called, else
+// DefaultTimeFormat.
+func (hook *FluentHook) effectiveTimeFormat() string {
+	if hook.timeFormat != nil {
+		return *hook.timeFormat
+	}
+	return DefaultTimeFormat
+}
+
+// SetHookOnlyPrefix sets the prefix this hook exclusively handles. See
+// HookOnlyPrefix for details.
+func (hook *FluentHook) SetHookOnlyPrefix(prefix string) {
+	hook.HookOnlyPrefix = prefix
+}
+
+// AddAlwaysSentField adds a field that is always included in this hook's
+// payload regardless of entry.Data. Unlike a package-level map shared by
+// every hook, each FluentHook keeps its own, so independent hooks in the
+// same process don't race on a shared set.
+func (hook *FluentHook) AddAlwaysSentField(name string, value interface{}) {
+	hook.alwaysSentFields[name] = value
+}
+
 // AddIgnore adds field name to ignore.
 func (hook *FluentHook) AddIgnore(name string) {
 	hook.ignoreFields[name] = struct{}{}
@@ -138,9 +242,6 @@ func (hook *FluentHook) AddFilter(name string, fn func(interface{}) interface{})
 
 // Fire is invoked by logrus and sends log to fluentd logger.
 func (hook *FluentHook) Fire(entry *logrus.Entry) error {
-	var logger *fluent.Fluent
-	var err error
-
 	//if PrefixOnly hook, filter out the prefixes and return
 	if hook.PrefixOnly {
 		for k := range entry.Data {
@@ -151,32 +252,20 @@ func (hook *FluentHook) Fire(entry *logrus.Entry) error {
 		return nil
 	}
 
-	switch {
-	case hook.Fluent != nil:
-		logger = hook.Fluent
-	default:
-		logger, err = fluent.New(fluent.Config{
-			FluentHost:    hook.host,
-			FluentPort:    hook.port,
-			MarshalAsJSON: true,
-		})
-		if err != nil {
-			return err
-		}
-		defer logger.Close()
-	}
-
-	//add AlwaysSentFields
+	//add this hook's AlwaysSentFields, plus the deprecated package-global set
 	for k, v := range AlwaysSentFields {
 		entry.Data[k] = v
 	}
-
-	if hook.app != "" {
-		entry.Data["_app"] = hook.app
+	for k, v := range hook.alwaysSentFields {
+		entry.Data[k] = v
 	}
 
 	// Create a map for passing to FluentD
 	data := make(logrus.Fields)
+	if hook.app != "" {
+		data["app"] = hook.app
+	}
+
 	for k, v := range entry.Data {
 		if _, ok := hook.ignoreFields[k]; ok {
 			continue
@@ -185,12 +274,29 @@ func (hook *FluentHook) Fire(entry *logrus.Entry) error {
 			v = fn(v)
 		}
 
-		//remove the prefix when logging to fluentd and remove fields starting with the prefix for subsequent log Fires
 		if Prefix != "" && strings.HasPrefix(k, Prefix) {
-			kTrimmed := strings.TrimPrefix(k, Prefix)
-			if _, inMap := entry.Data[kTrimmed]; !inMap {
+			switch {
+			case hook.HookOnlyPrefix != "":
+				// This hook exclusively owns HookOnlyPrefix: only fields
+				// matching it are sent (trimmed) and removed from
+				// entry.Data for hooks firing after this one. Fields
+				// carrying Prefix but not this hook's HookOnlyPrefix are
+				// left untouched for whichever hook does own them.
+				if !strings.HasPrefix(k, hook.HookOnlyPrefix) {
+					continue
+				}
 				delete(entry.Data, k)
-				k = kTrimmed
+				k = strings.TrimPrefix(k, hook.HookOnlyPrefix)
+			default:
+				// No HookOnlyPrefix configured: every hook's default
+				// behavior, unchanged since before HookOnlyPrefix
+				// existed -- trim and send, unless a field with the
+				// trimmed name already exists.
+				kTrimmed := strings.TrimPrefix(k, Prefix)
+				if _, inMap := entry.Data[kTrimmed]; !inMap {
+					delete(entry.Data, k)
+					k = kTrimmed
+				}
 			}
 		}
 
@@ -209,10 +315,40 @@ func (hook *FluentHook) Fire(entry *logrus.Entry) error {
 	if tag != entry.Message {
 		setMessage(entry, data)
 	}
+	hook.applySchema(entry, data)
 
 	fluentData := ConvertToValue(data, TagName)
-	err = logger.PostWithTime(tag, entry.Time, fluentData)
-	return err
+	if hook.privacy {
+		fluentData = hook.redact(fluentData)
+	}
+
+	if hook.dispatcher != nil {
+		hook.dispatcher.enqueue(fluentMessage{tag: tag, time: entry.Time, data: fluentData})
+		return nil
+	}
+
+	if hook.postFunc != nil {
+		return hook.postFunc(tag, entry.Time, fluentData)
+	}
+
+	var logger *fluent.Fluent
+	switch {
+	case hook.Fluent != nil:
+		logger = hook.Fluent
+	default:
+		fc, err := hook.cfg.fluentConfig()
+		if err != nil {
+			return err
+		}
+
+		logger, err = fluent.New(fc)
+		if err != nil {
+			return err
+		}
+		defer logger.Close()
+	}
+
+	return logger.PostWithTime(tag, entry.Time, fluentData)
 }
 
 // getTagAndDel extracts tag data from log entry and custom log fields.
@@ -250,6 +386,28 @@ func (hook *FluentHook) getTag(entry *logrus.Entry, data logrus.Fields) string {
 	}
 }
 
+// applySchema reshapes data in place to match hook.schema. Under
+// SchemaFluentd it only adds a "time" field, and only once SetTimeFormat has
+// been called; existing callers that never touch SetTimeFormat see no
+// change. Under SchemaLogstash it always reshapes the payload to the
+// Logstash event schema.
+func (hook *FluentHook) applySchema(entry *logrus.Entry, data logrus.Fields) {
+	switch hook.schema {
+	case SchemaLogstash:
+		data["@version"] = "1"
+		data["@timestamp"] = entry.Time.Format(hook.effectiveTimeFormat())
+
+		if app, ok := data["app"]; ok {
+			data["type"] = app
+			delete(data, "app")
+		}
+	default:
+		if hook.timeFormat != nil {
+			data["time"] = entry.Time.Format(*hook.timeFormat)
+		}
+	}
+}
+
 func setLevelString(entry *logrus.Entry, data logrus.Fields) {
 	data["level"] = entry.Level.String()
 }
@@ -0,0 +1,138 @@
+package logrus_fluent
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Redactor transforms a single field value, typically masking part of it.
+// A Redactor should return v unchanged when it doesn't recognize the
+// value's shape, since the same set of redactors is applied to every
+// field (and, recursively, to every nested value) regardless of type.
+type Redactor func(v interface{}) interface{}
+
+var emailPattern = regexp.MustCompile(`[^@\s]+@[^@\s]+`)
+
+// RedactIPv4 returns a Redactor that zeroes the last octet of IPv4
+// addresses, e.g. "192.168.1.42" becomes "192.168.1.0".
+func RedactIPv4() Redactor {
+	return func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return v
+		}
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return v
+		}
+
+		ip4[3] = 0
+		return ip4.String()
+	}
+}
+
+// RedactIPv6 returns a Redactor that zeroes the last hextet of IPv6
+// addresses.
+func RedactIPv6() Redactor {
+	return func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() != nil {
+			return v
+		}
+		ip16 := ip.To16()
+		if ip16 == nil {
+			return v
+		}
+
+		ip16[14] = 0
+		ip16[15] = 0
+		return ip16.String()
+	}
+}
+
+// RedactEmail returns a Redactor that masks the local part of every email
+// address found in a string value, keeping the domain, e.g. "alice@example.com"
+// becomes "***@example.com". It matches embedded addresses too, e.g.
+// "failed to notify alice@example.com" becomes "failed to notify ***@example.com".
+func RedactEmail() Redactor {
+	return func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+
+		return emailPattern.ReplaceAllStringFunc(s, func(match string) string {
+			at := strings.IndexByte(match, '@')
+			if at < 0 {
+				return match
+			}
+			return "***" + match[at:]
+		})
+	}
+}
+
+// RedactRegexp returns a Redactor that replaces every match of re in
+// string values with replacement.
+func RedactRegexp(re *regexp.Regexp, replacement string) Redactor {
+	return func(v interface{}) interface{} {
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+
+		return re.ReplaceAllString(s, replacement)
+	}
+}
+
+// SetPrivacy enables or disables redaction of the payload sent to
+// fluentd. When enabled, every registered Redactor (see AddRedactor) runs
+// over the converted payload after filters have already run in Fire,
+// recursing into nested maps and slices so struct and map fields are
+// covered, not just top-level ones. This also covers the Message field,
+// since it is just another entry in that payload by the time redaction
+// runs.
+func (hook *FluentHook) SetPrivacy(enabled bool) {
+	hook.privacy = enabled
+}
+
+// AddRedactor registers a named Redactor. Redactors run in no particular
+// order, so they should be independent of one another.
+func (hook *FluentHook) AddRedactor(name string, r Redactor) {
+	hook.redactors[name] = r
+}
+
+// redact walks v, applying every registered redactor to each scalar leaf.
+// It recurses into map[string]interface{} and []interface{}, which is
+// what ConvertToValue produces for nested struct/map/slice fields.
+func (hook *FluentHook) redact(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(vv))
+		for k, val := range vv {
+			out[k] = hook.redact(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(vv))
+		for i, val := range vv {
+			out[i] = hook.redact(val)
+		}
+		return out
+	default:
+		for _, r := range hook.redactors {
+			v = r(v)
+		}
+		return v
+	}
+}
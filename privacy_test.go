@@ -0,0 +1,128 @@
+package logrus_fluent
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestRedactIPv4(t *testing.T) {
+	r := RedactIPv4()
+	if got := r("192.168.1.42"); got != "192.168.1.0" {
+		t.Fatalf("got %v, want 192.168.1.0", got)
+	}
+	if got := r("not an ip"); got != "not an ip" {
+		t.Fatalf("expected non-IP value unchanged, got %v", got)
+	}
+}
+
+func TestRedactIPv6(t *testing.T) {
+	r := RedactIPv6()
+	got := r("2001:db8::1")
+	if got == "2001:db8::1" {
+		t.Fatalf("expected last hextet to be zeroed, got %v", got)
+	}
+	if got := r("192.168.1.42"); got != "192.168.1.42" {
+		t.Fatalf("expected IPv4 value unchanged, got %v", got)
+	}
+}
+
+func TestRedactEmailExactMatch(t *testing.T) {
+	r := RedactEmail()
+	if got := r("alice@example.com"); got != "***@example.com" {
+		t.Fatalf("got %v, want ***@example.com", got)
+	}
+}
+
+func TestRedactEmailEmbeddedInText(t *testing.T) {
+	r := RedactEmail()
+	got := r("failed to notify alice@example.com")
+	want := "failed to notify ***@example.com"
+	if got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRedactRegexp(t *testing.T) {
+	r := RedactRegexp(regexp.MustCompile(`\d+`), "#")
+	if got := r("order 12345 shipped"); got != "order # shipped" {
+		t.Fatalf("got %v, want \"order # shipped\"", got)
+	}
+}
+
+func TestHookRedactRecursion(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+	hook.AddRedactor("email", RedactEmail())
+
+	data := map[string]interface{}{
+		"message": "contact alice@example.com",
+		"nested": map[string]interface{}{
+			"to": "bob@example.com",
+		},
+		"list": []interface{}{"carol@example.com", 42},
+	}
+
+	redacted := hook.redact(data).(map[string]interface{})
+
+	if redacted["message"] != "contact ***@example.com" {
+		t.Fatalf("message = %v", redacted["message"])
+	}
+	if redacted["nested"].(map[string]interface{})["to"] != "***@example.com" {
+		t.Fatalf("nested.to = %v", redacted["nested"])
+	}
+	list := redacted["list"].([]interface{})
+	if list[0] != "***@example.com" {
+		t.Fatalf("list[0] = %v", list[0])
+	}
+	if list[1] != 42 {
+		t.Fatalf("list[1] = %v, want 42 unchanged", list[1])
+	}
+}
+
+type contactInfo struct {
+	Email string `fluent:"email"`
+	Tags  []string
+}
+
+// TestFireRedactsNestedStructThroughConvertToValue drives Fire end-to-end
+// with a struct field, so the payload redact walks is the real
+// map[string]interface{}/[]interface{} shape ConvertToValue produces, not
+// a hand-built literal standing in for it.
+func TestFireRedactsNestedStructThroughConvertToValue(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+	hook.SetPrivacy(true)
+	hook.AddRedactor("email", RedactEmail())
+
+	var got map[string]interface{}
+	hook.postFunc = func(tag string, tm time.Time, data interface{}) error {
+		got = data.(map[string]interface{})
+		return nil
+	}
+
+	entry := &logrus.Entry{
+		Time:    time.Now(),
+		Message: "signup",
+		Data: logrus.Fields{
+			"contact": contactInfo{Email: "alice@example.com", Tags: []string{"vip"}},
+		},
+	}
+
+	if err := hook.Fire(entry); err != nil {
+		t.Fatalf("Fire returned error: %v", err)
+	}
+
+	contact, ok := got["contact"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("contact = %#v, want map[string]interface{}", got["contact"])
+	}
+	if contact["email"] != "***@example.com" {
+		t.Fatalf("contact.email = %v, want ***@example.com", contact["email"])
+	}
+
+	tags, ok := contact["Tags"].([]interface{})
+	if !ok || len(tags) != 1 || tags[0] != "vip" {
+		t.Fatalf("contact.Tags = %#v, want [\"vip\"]", contact["Tags"])
+	}
+}
@@ -0,0 +1,76 @@
+package logrus_fluent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestApplySchemaFluentdDefault(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+
+	entry := &logrus.Entry{Time: time.Now()}
+	data := logrus.Fields{"message": "hi"}
+	hook.applySchema(entry, data)
+
+	if _, ok := data["time"]; ok {
+		t.Fatalf("expected no \"time\" field without SetTimeFormat, got %v", data["time"])
+	}
+	if _, ok := data["@version"]; ok {
+		t.Fatalf("expected no \"@version\" field under SchemaFluentd")
+	}
+}
+
+func TestApplySchemaFluentdWithTimeFormat(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+	hook.SetTimeFormat(time.RFC3339)
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := &logrus.Entry{Time: now}
+	data := logrus.Fields{"message": "hi"}
+	hook.applySchema(entry, data)
+
+	want := now.Format(time.RFC3339)
+	if got := data["time"]; got != want {
+		t.Fatalf("time = %v, want %v", got, want)
+	}
+}
+
+func TestApplySchemaLogstashDefaultFormat(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+	hook.SetSchema(SchemaLogstash)
+
+	now := time.Now()
+	entry := &logrus.Entry{Time: now}
+	data := logrus.Fields{"app": "myapp"}
+	hook.applySchema(entry, data)
+
+	if data["@version"] != "1" {
+		t.Fatalf("@version = %v, want \"1\"", data["@version"])
+	}
+	if want := now.Format(DefaultTimeFormat); data["@timestamp"] != want {
+		t.Fatalf("@timestamp = %v, want %v", data["@timestamp"], want)
+	}
+	if data["type"] != "myapp" {
+		t.Fatalf("type = %v, want \"myapp\"", data["type"])
+	}
+	if _, ok := data["app"]; ok {
+		t.Fatalf("expected \"app\" to be removed once copied to \"type\"")
+	}
+}
+
+func TestApplySchemaLogstashCustomFormat(t *testing.T) {
+	hook := NewHook("localhost", 24224)
+	hook.SetSchema(SchemaLogstash)
+	hook.SetTimeFormat(time.RFC822)
+
+	now := time.Now()
+	entry := &logrus.Entry{Time: now}
+	data := logrus.Fields{}
+	hook.applySchema(entry, data)
+
+	if want := now.Format(time.RFC822); data["@timestamp"] != want {
+		t.Fatalf("@timestamp = %v, want %v", data["@timestamp"], want)
+	}
+}